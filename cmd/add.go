@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/alwindoss/sym/internal/sym"
+	"github.com/spf13/cobra"
+)
+
+var (
+	adoptFlag, backupFlag, forceFlag bool
+)
+
+// addCmd represents the add command
+var addCmd = &cobra.Command{
+	Use:   "add <pkgs...>",
+	Short: "Sym one or more packages, creating their symlinks in the target directory",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := buildConfig(args)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case adoptFlag:
+			config.Conflict = sym.ConflictAdopt
+		case backupFlag:
+			config.Conflict = sym.ConflictBackup
+		case forceFlag:
+			config.Conflict = sym.ConflictOverwrite
+		}
+
+		for _, pkg := range config.Packages {
+			if err := sym.ProcessPackage(config, pkg, sym.OperationSym); err != nil {
+				return fmt.Errorf("error processing package '%s': %w", pkg, err)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(addCmd)
+
+	addCmd.Flags().BoolVar(&adoptFlag, "adopt", false, "on conflict, adopt the existing target file into the package")
+	addCmd.Flags().BoolVar(&backupFlag, "backup", false, "on conflict, back up the existing target before overwriting it")
+	addCmd.Flags().BoolVar(&forceFlag, "force", false, "on conflict, overwrite the existing target unconditionally")
+}
@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/alwindoss/sym/internal/sym"
+)
+
+// buildConfig resolves the shared persistent flags into a sym.Config with
+// absolute paths, ready to be passed to sym.ProcessPackage.
+func buildConfig(packages []string) (*sym.Config, error) {
+	config := &sym.Config{
+		SymDir:      symDir,
+		TargetDir:   targetDir,
+		Verbose:     verbose,
+		Simulate:    simulate,
+		NoFolding:   noFolding,
+		NoLock:      noLock,
+		LockTimeout: lockTimeout,
+		ExtraIgnore: extraIgnore,
+		Packages:    packages,
+	}
+
+	var err error
+	config.SymDir, err = filepath.Abs(config.SymDir)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving stow directory: %w", err)
+	}
+
+	config.TargetDir, err = filepath.Abs(config.TargetDir)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving target directory: %w", err)
+	}
+
+	if config.Verbose {
+		fmt.Printf("Stow dir: %s\n", config.SymDir)
+		fmt.Printf("Target dir: %s\n", config.TargetDir)
+	}
+
+	return config, nil
+}
+
+// runOperation resolves the shared config and runs op against every
+// package in args.
+func runOperation(args []string, op sym.Operation) error {
+	config, err := buildConfig(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	for _, pkg := range config.Packages {
+		if err := sym.ProcessPackage(config, pkg, op); err != nil {
+			return fmt.Errorf("error processing package '%s': %w", pkg, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/alwindoss/sym/internal/sym"
+	"github.com/spf13/cobra"
+)
+
+// listCmd represents the list command
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List packages currently symed into the target directory",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := buildConfig(nil)
+		if err != nil {
+			return err
+		}
+
+		return sym.ListPackages(config, os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+}
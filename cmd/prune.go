@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"github.com/alwindoss/sym/internal/sym"
+	"github.com/spf13/cobra"
+)
+
+// pruneCmd represents the prune command
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove managed symlinks whose source file no longer exists",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := buildConfig(nil)
+		if err != nil {
+			return err
+		}
+
+		return sym.Prune(config)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(pruneCmd)
+}
@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/alwindoss/sym/internal/sym"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneDirsFlag, restoreBackupsFlag bool
+)
+
+// removeCmd represents the remove command
+var removeCmd = &cobra.Command{
+	Use:     "remove <pkgs...>",
+	Aliases: []string{"rm"},
+	Short:   "Unsym one or more packages, removing their managed symlinks",
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := buildConfig(args)
+		if err != nil {
+			return err
+		}
+		config.PruneDirs = pruneDirsFlag
+		config.RestoreBackups = restoreBackupsFlag
+
+		for _, pkg := range config.Packages {
+			if err := sym.ProcessPackage(config, pkg, sym.OperationUnsym); err != nil {
+				return fmt.Errorf("error processing package '%s': %w", pkg, err)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(removeCmd)
+
+	removeCmd.Flags().BoolVar(&pruneDirsFlag, "prune-dirs", false, "remove directories left empty after unsyming")
+	removeCmd.Flags().BoolVar(&restoreBackupsFlag, "restore-backups", false, "restore any files backed up by a prior --backup add")
+}
@@ -0,0 +1,20 @@
+package cmd
+
+import (
+	"github.com/alwindoss/sym/internal/sym"
+	"github.com/spf13/cobra"
+)
+
+// restowCmd represents the restow command
+var restowCmd = &cobra.Command{
+	Use:   "restow <pkgs...>",
+	Short: "Unsym and then sym one or more packages, useful after updating a package",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runOperation(args, sym.OperationResym)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(restowCmd)
+}
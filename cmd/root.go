@@ -4,7 +4,7 @@ package cmd
 import (
 	"fmt"
 	"os"
-	"path/filepath"
+	"time"
 
 	"github.com/alwindoss/sym/internal/sym"
 	"github.com/spf13/cobra"
@@ -17,69 +17,45 @@ var cfgFile string
 var rootCmd = &cobra.Command{
 	Use:   "sym",
 	Short: "A fast symlink farm manager for dotfiles and packages",
-	Long: `Sym is a modern symlink farm manager written in Go, designed to help you 
+	Long: `Sym is a modern symlink farm manager written in Go, designed to help you
 organize and deploy your dotfiles, configuration files, and software packages.
 
 By creating symbolic links from a centralized source directory to target locations,
-Sym allows you to maintain a clean, version-controlled collection of your 
+Sym allows you to maintain a clean, version-controlled collection of your
 configuration files while making them appear in their expected system locations.
 
 Key features:
-  • Sym packages by creating symlinks to target directories  
+  • Sym packages by creating symlinks to target directories
   • Unsym packages by safely removing managed symlinks
   • Resym packages for easy updates and reorganization
   • Dry-run mode to preview changes before applying them
   • Verbose output for detailed operation logging
   • Safe conflict detection and resolution
 
+Use the 'add', 'remove' and 'restow' subcommands, or the 'list'/'status'
+subcommands to inspect what is currently symed.
+
 Perfect for managing dotfiles, development environments, and system configurations
 across multiple machines with version control integration.`,
-	// Uncomment the following line if your bare application
-	// has an action associated with it:
-	// Run: func(cmd *cobra.Command, args []string) { },
+	// Calling 'sym <pkgs...>' with no subcommand is kept working for
+	// backward compatibility; --delete and --resym are deprecated in favor
+	// of the 'remove' and 'restow' subcommands.
 	RunE: func(cmd *cobra.Command, args []string) error {
-		config := &sym.Config{
-			SymDir:    symDir,
-			TargetDir: targetDir,
-			Verbose:   verbose,
-			Simulate:  simulate,
-			Delete:    deleteFlag,
-			ReSym:     resym,
-		}
-
-		config.Packages = args
-		if len(config.Packages) == 0 {
+		if len(args) == 0 {
 			fmt.Fprintf(os.Stderr, "error: No packages specified\n\n\n")
 			cmd.Help()
 			os.Exit(1)
 		}
 
-		// Convert to absolute paths
-		var err error
-		config.SymDir, err = filepath.Abs(config.SymDir)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error resolving stow directory: %v\n", err)
-			os.Exit(1)
-		}
-
-		config.TargetDir, err = filepath.Abs(config.TargetDir)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error resolving target directory: %v\n", err)
-			os.Exit(1)
+		op := sym.OperationSym
+		switch {
+		case resym:
+			op = sym.OperationResym
+		case deleteFlag:
+			op = sym.OperationUnsym
 		}
 
-		if config.Verbose {
-			fmt.Printf("Stow dir: %s\n", config.SymDir)
-			fmt.Printf("Target dir: %s\n", config.TargetDir)
-		}
-
-		for _, pkg := range config.Packages {
-			if err := sym.ProcessPackage(config, pkg); err != nil {
-				err = fmt.Errorf("error processing package '%s': %w", pkg, err)
-				return err
-			}
-		}
-		return nil
+		return runOperation(args, op)
 	},
 }
 
@@ -93,30 +69,35 @@ func Execute() {
 }
 
 var (
-	symDir, targetDir                             string
-	verbose, simulate, deleteFlag, resym, version bool
+	symDir, targetDir                                        string
+	verbose, simulate, deleteFlag, resym, version, noFolding bool
+	noLock                                                   bool
+	lockTimeout                                              time.Duration
+	extraIgnore                                              []string
 )
 
 func init() {
 	cobra.OnInitialize(initConfig)
 
-	// Here you will define your flags and configuration settings.
-	// Cobra supports persistent flags, which, if defined here,
-	// will be global for your application.
-
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.sym.yaml)")
 
-	// Cobra also supports local flags, which will only run
-	// when this action is called directly.
-	// rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
-
-	// Sym flags
-	rootCmd.Flags().StringVarP(&symDir, "dir", "d", ".", "sym directory")
-	rootCmd.Flags().StringVarP(&targetDir, "target", "t", "..", "target directory")
-	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
-	rootCmd.Flags().BoolVarP(&simulate, "simulate", "n", false, "simulate actions (dry run)")
+	// Shared flags, available to every subcommand.
+	rootCmd.PersistentFlags().StringVarP(&symDir, "dir", "d", ".", "sym directory")
+	rootCmd.PersistentFlags().StringVarP(&targetDir, "target", "t", "..", "target directory")
+	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().BoolVarP(&simulate, "simulate", "n", false, "simulate actions (dry run)")
+	rootCmd.PersistentFlags().BoolVar(&noFolding, "no-folding", false, "disable tree folding, always create real directories")
+	rootCmd.PersistentFlags().StringArrayVar(&extraIgnore, "ignore", nil, "glob pattern to ignore, in addition to .sym.yaml (repeatable)")
+	rootCmd.PersistentFlags().DurationVar(&lockTimeout, "lock-timeout", 30*time.Second, "how long to wait for the sym lock before giving up")
+	rootCmd.PersistentFlags().BoolVar(&noLock, "no-lock", false, "disable locking SymDir, allowing concurrent sym invocations")
+
+	// Deprecated flags, kept for backward compatibility with the old
+	// flag-only CLI. Prefer the 'remove'/'restow' subcommands.
 	rootCmd.Flags().BoolVarP(&deleteFlag, "delete", "D", false, "delete/unsym packages")
 	rootCmd.Flags().BoolVarP(&resym, "resym", "R", false, "resym packages (unsym then sym)")
+	rootCmd.Flags().MarkDeprecated("delete", "use the 'remove' subcommand instead")
+	rootCmd.Flags().MarkDeprecated("resym", "use the 'restow' subcommand instead")
+
 	rootCmd.Flags().BoolVar(&version, "version", false, "show version")
 }
 
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/alwindoss/sym/internal/sym"
+	"github.com/spf13/cobra"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status <pkg>",
+	Short: "Show the managed links for a symed package, including broken links and drift",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config, err := buildConfig(nil)
+		if err != nil {
+			return err
+		}
+
+		return sym.StatusPackage(config, args[0], os.Stdout)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
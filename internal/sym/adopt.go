@@ -0,0 +1,174 @@
+package sym
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// resolveConflict decides what to do about a target that already exists and
+// isn't already the symlink createSymlink wants to put there, based on
+// config.Conflict. On success the target is left in a state where
+// createSymlink can proceed to create the symlink.
+func resolveConflict(config *Config, pkg, srcPath, targetPath string, info os.FileInfo, manifest *Manifest) error {
+	switch config.Conflict {
+	case ConflictOverwrite:
+		if config.Verbose {
+			fmt.Printf("Overwriting existing target: %s\n", targetPath)
+		}
+		if config.Simulate {
+			return nil
+		}
+		if err := os.RemoveAll(targetPath); err != nil {
+			return fmt.Errorf("failed to overwrite %s: %w", targetPath, err)
+		}
+		return nil
+
+	case ConflictBackup:
+		backup := fmt.Sprintf("%s.sym-backup-%d", targetPath, time.Now().Unix())
+		if config.Verbose {
+			fmt.Printf("Backing up %s to %s\n", targetPath, backup)
+		}
+		if config.Simulate {
+			return nil
+		}
+		if err := os.Rename(targetPath, backup); err != nil {
+			return fmt.Errorf("failed to back up %s: %w", targetPath, err)
+		}
+		manifest.recordBackup(pkg, targetPath, backup)
+		return nil
+
+	case ConflictAdopt:
+		if info.IsDir() {
+			return fmt.Errorf("cannot adopt directory %s, adopt only supports files", targetPath)
+		}
+		if config.Verbose {
+			fmt.Printf("Adopting %s into %s\n", targetPath, srcPath)
+		}
+		if config.Simulate {
+			return nil
+		}
+		return adoptFile(targetPath, srcPath)
+
+	default:
+		if link, err := os.Readlink(targetPath); err == nil {
+			return fmt.Errorf("target %s already exists and points to %s (not %s)",
+				targetPath, link, srcPath)
+		}
+		return fmt.Errorf("target %s already exists and is not a symlink", targetPath)
+	}
+}
+
+// adoptFile moves targetPath into the package at srcPath, so the
+// previously unmanaged file becomes the source of truth. The original is
+// copied in and fsynced before being removed, and the copy is verified
+// against the original content and mode so a failure never leaves both
+// sides missing.
+func adoptFile(targetPath, srcPath string) error {
+	info, err := os.Stat(targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s for adoption: %w", targetPath, err)
+	}
+	mode := info.Mode().Perm()
+
+	data, err := os.ReadFile(targetPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s for adoption: %w", targetPath, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(srcPath), 0755); err != nil {
+		return fmt.Errorf("failed to create package directory for %s: %w", srcPath, err)
+	}
+
+	f, err := os.OpenFile(srcPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("failed to adopt %s into %s: %w", targetPath, srcPath, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to adopt %s into %s: %w", targetPath, srcPath, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync adopted file %s: %w", srcPath, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close adopted file %s: %w", srcPath, err)
+	}
+	// OpenFile's mode is only honored when it creates srcPath; chmod
+	// explicitly in case srcPath already existed with a different mode.
+	if err := os.Chmod(srcPath, mode); err != nil {
+		return fmt.Errorf("failed to set mode on adopted file %s: %w", srcPath, err)
+	}
+
+	adopted, err := os.ReadFile(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to verify adopted file %s: %w", srcPath, err)
+	}
+	if !bytes.Equal(adopted, data) {
+		return fmt.Errorf("adopted file %s does not match original %s, aborting", srcPath, targetPath)
+	}
+	adoptedInfo, err := os.Stat(srcPath)
+	if err != nil {
+		return fmt.Errorf("failed to verify adopted file %s: %w", srcPath, err)
+	}
+	if adoptedInfo.Mode().Perm() != mode {
+		return fmt.Errorf("adopted file %s has mode %s, want %s, aborting", srcPath, adoptedInfo.Mode().Perm(), mode)
+	}
+
+	if err := os.Remove(targetPath); err != nil {
+		return fmt.Errorf("failed to remove adopted original %s: %w", targetPath, err)
+	}
+	return nil
+}
+
+// pruneEmptyDirs removes dir and any now-empty ancestors up to TargetDir,
+// used by remove --prune-dirs to clean up directories left behind by the
+// last symlink in them.
+func pruneEmptyDirs(config *Config, dir string) {
+	for dir != config.TargetDir && strings.HasPrefix(dir, config.TargetDir) {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+
+		if config.Verbose {
+			fmt.Printf("Pruning empty directory: %s\n", dir)
+		}
+		if !config.Simulate {
+			if err := os.Remove(dir); err != nil {
+				return
+			}
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// restoreBackups restores every backup recorded for pkg, renaming each one
+// back to the target path it was taken from.
+func restoreBackups(config *Config, pkg string, manifest *Manifest) error {
+	rec, ok := manifest.Packages[pkg]
+	if !ok || len(rec.Backups) == 0 {
+		return nil
+	}
+
+	for _, b := range rec.Backups {
+		if config.Verbose {
+			fmt.Printf("Restoring backup: %s -> %s\n", b.Backup, b.Target)
+		}
+		if !config.Simulate {
+			if err := os.Rename(b.Backup, b.Target); err != nil {
+				return fmt.Errorf("failed to restore backup %s: %w", b.Backup, err)
+			}
+		}
+	}
+
+	rec.Backups = nil
+	if len(rec.Links) == 0 {
+		delete(manifest.Packages, pkg)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package sym
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// errIgnoredInSubtree is a sentinel used to abort a filepath.Walk as soon as
+// an ignored entry is found, without scanning the rest of the tree.
+var errIgnoredInSubtree = errors.New("ignored entry found in subtree")
+
+// foldDirectory probes whether srcDir can be symlinked into targetPath as a
+// whole instead of recursing and linking every file beneath it (GNU Stow
+// style tree folding). Folding applies when targetPath does not exist yet,
+// when it is already this package's own fold of srcDir (so re-syming an
+// already-folded package is a no-op instead of unfolding it), or when it
+// exists as a real directory containing only symlinks this same package
+// already owns (e.g. a previous partial sym of the package), so it never
+// shadows a real file or another package's links. It never folds a subtree
+// that contains an ignored entry, since folding would symlink the ignored
+// file in along with everything else.
+func foldDirectory(config *Config, pkg, pkgPath, srcDir, targetPath string, manifest *Manifest, pkgConfig *PkgConfig) (bool, error) {
+	ignored, err := subtreeIgnored(pkgConfig, pkgPath, srcDir, config.ExtraIgnore)
+	if err != nil {
+		return false, err
+	}
+	if ignored {
+		return false, nil
+	}
+
+	var owned []LinkRecord
+	if info, err := os.Lstat(targetPath); err == nil {
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err := os.Readlink(targetPath); err == nil && link == srcDir {
+				// Already folded by this same package; leave it alone.
+				markFolded(manifest, pkg, targetPath)
+				return true, nil
+			}
+			return false, nil
+		}
+		if !info.IsDir() {
+			return false, nil
+		}
+		var ok bool
+		ok, owned = ownedSymlinks(pkg, targetPath, manifest)
+		if !ok {
+			return false, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	if len(owned) > 0 {
+		if config.Verbose {
+			fmt.Printf("Re-folding directory previously split into %d link(s): %s\n", len(owned), targetPath)
+		}
+		if !config.Simulate {
+			for _, link := range owned {
+				if err := os.Remove(link.Target); err != nil {
+					return false, fmt.Errorf("failed to remove %s while re-folding: %w", link.Target, err)
+				}
+			}
+			if err := os.Remove(targetPath); err != nil {
+				return false, fmt.Errorf("failed to remove %s while re-folding: %w", targetPath, err)
+			}
+		}
+		for _, link := range owned {
+			manifest.removeLink(pkg, link.Target)
+		}
+	}
+
+	if config.Verbose {
+		fmt.Printf("Folding directory: %s -> %s\n", targetPath, srcDir)
+	}
+
+	if err := createSymlink(config, pkg, pkgPath, srcDir, targetPath, manifest); err != nil {
+		return false, err
+	}
+
+	markFolded(manifest, pkg, targetPath)
+
+	return true, nil
+}
+
+// markFolded flags the manifest's link record for targetPath as a folded
+// directory link rather than a single file, so a later unsym or fold
+// decision can tell the two apart.
+func markFolded(manifest *Manifest, pkg, targetPath string) {
+	rec, ok := manifest.Packages[pkg]
+	if !ok {
+		return
+	}
+	for i := range rec.Links {
+		if rec.Links[i].Target == targetPath {
+			rec.Links[i].Dir = true
+			break
+		}
+	}
+}
+
+// subtreeIgnored reports whether any entry under srcDir (a subdirectory of
+// pkgPath) matches an ignore glob or an explicit pkgConfig.Links remap, in
+// which case the whole subtree must be walked file-by-file rather than
+// folded: an ignored entry must never be symlinked in, and a Links-mapped
+// entry must end up only at its remapped target, not also mirrored inside
+// the folded directory.
+func subtreeIgnored(pkgConfig *PkgConfig, pkgPath, srcDir string, extra []string) (bool, error) {
+	err := filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == srcDir {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(pkgPath, path)
+		if err != nil {
+			return err
+		}
+		if relPath == pkgConfigFileName {
+			return nil
+		}
+		if _, explicit := pkgConfig.Links[relPath]; explicit {
+			return errIgnoredInSubtree
+		}
+
+		matched, err := pkgConfig.ignored(relPath, extra)
+		if err != nil {
+			return err
+		}
+		if matched {
+			return errIgnoredInSubtree
+		}
+		return nil
+	})
+
+	if errors.Is(err, errIgnoredInSubtree) {
+		return true, nil
+	}
+	return false, err
+}
+
+// ownedSymlinks reports whether every entry directly under targetPath is a
+// symlink already recorded as owned by pkg, returning those link records so
+// the caller can remove them before replacing the directory with a single
+// folded symlink.
+func ownedSymlinks(pkg, targetPath string, manifest *Manifest) (bool, []LinkRecord) {
+	entries, err := os.ReadDir(targetPath)
+	if err != nil || len(entries) == 0 {
+		return false, nil
+	}
+
+	rec, ok := manifest.Packages[pkg]
+	if !ok {
+		return false, nil
+	}
+	byTarget := make(map[string]LinkRecord, len(rec.Links))
+	for _, link := range rec.Links {
+		byTarget[link.Target] = link
+	}
+
+	owned := make([]LinkRecord, 0, len(entries))
+	for _, entry := range entries {
+		full := filepath.Join(targetPath, entry.Name())
+		info, err := os.Lstat(full)
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			return false, nil
+		}
+		link, ok := byTarget[full]
+		if !ok {
+			return false, nil
+		}
+		owned = append(owned, link)
+	}
+
+	return true, owned
+}
+
+// ensureUnfolded reverses a prior tree-folding decision at targetPath if one
+// exists: it replaces the directory symlink with a real directory and
+// recreates individual file symlinks for the package that folded it, so a
+// second package can add its own entries alongside them.
+func ensureUnfolded(config *Config, targetPath string, manifest *Manifest) error {
+	info, err := os.Lstat(targetPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+
+	ownerPkg, rec, link, ok := manifest.findFold(targetPath)
+	if !ok {
+		// Not a directory sym folded, leave whatever it is alone.
+		return nil
+	}
+
+	if config.Verbose {
+		fmt.Printf("Unfolding directory: %s\n", targetPath)
+	}
+
+	if config.Simulate {
+		return nil
+	}
+
+	if err := os.Remove(targetPath); err != nil {
+		return fmt.Errorf("failed to unfold %s: %w", targetPath, err)
+	}
+	if err := os.MkdirAll(targetPath, 0755); err != nil {
+		return fmt.Errorf("failed to recreate directory %s: %w", targetPath, err)
+	}
+	manifest.removeLink(ownerPkg, targetPath)
+
+	return filepath.Walk(link.Source, func(srcPath string, srcInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if srcPath == link.Source {
+			return nil
+		}
+
+		rel, err := filepath.Rel(link.Source, srcPath)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(targetPath, rel)
+
+		if srcInfo.IsDir() {
+			return os.MkdirAll(dstPath, srcInfo.Mode())
+		}
+		return createSymlink(config, ownerPkg, rec.Source, srcPath, dstPath, manifest)
+	})
+}
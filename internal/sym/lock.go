@@ -0,0 +1,80 @@
+package sym
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const lockFileName = "lock"
+
+// Lock is an advisory, cross-process lock held on a SymDir while sym
+// mutates its filesystem state, guarding against two invocations racing on
+// the same package. The platform-specific locking primitive is in
+// lock_unix.go / lock_windows.go.
+type Lock struct {
+	file *os.File
+}
+
+// acquireLock takes the advisory lock for symDir, polling until it
+// succeeds or timeout elapses.
+func acquireLock(symDir string, timeout time.Duration) (*Lock, error) {
+	dir := filepath.Join(symDir, manifestDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory %s: %w", dir, err)
+	}
+
+	path := filepath.Join(dir, lockFileName)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s: %w", path, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	var lockErr error
+	for {
+		if lockErr = lockFile(f); lockErr == nil {
+			return &Lock{file: f}, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("timed out after %s waiting for lock %s: %w", timeout, path, lockErr)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Release releases the lock and closes the underlying file. It is safe to
+// call on a nil Lock.
+func (l *Lock) Release() error {
+	if l == nil {
+		return nil
+	}
+	if err := unlockFile(l.file); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
+
+// withLock acquires the SymDir lock for the duration of an operation driven
+// by config, honoring config.NoLock. It also skips acquiring the lock in
+// Simulate mode, since a dry run touches nothing on disk and has no need to
+// mutate the lock file either. The returned release func is always safe to
+// call, including when no lock was taken.
+func withLock(config *Config) (release func() error, err error) {
+	if config.NoLock || config.Simulate {
+		return func() error { return nil }, nil
+	}
+
+	timeout := config.LockTimeout
+	if timeout <= 0 {
+		timeout = defaultLockTimeout
+	}
+	lock, err := acquireLock(config.SymDir, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire sym lock: %w", err)
+	}
+	return lock.Release, nil
+}
@@ -0,0 +1,187 @@
+package sym
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	manifestDirName  = ".sym"
+	manifestFileName = "state.json"
+)
+
+// LinkRecord describes a single symlink that sym created on behalf of a
+// package, so that a later unsym can remove it without re-walking the
+// source tree.
+type LinkRecord struct {
+	Target string `json:"target"`
+	Source string `json:"source"`
+	// Dir marks a folded directory link: Target is a symlink to Source,
+	// a package subdirectory, standing in for every file beneath it.
+	Dir bool `json:"dir,omitempty"`
+}
+
+// BackupRecord is an original file that createSymlink moved aside under
+// ConflictBackup, kept so a later unsym --restore-backups can put it back.
+type BackupRecord struct {
+	Target string `json:"target"`
+	Backup string `json:"backup"`
+}
+
+// PackageRecord is the persisted state for one symed package.
+type PackageRecord struct {
+	Name      string         `json:"name"`
+	Source    string         `json:"source"`
+	Version   string         `json:"version"`
+	Installed time.Time      `json:"installed"`
+	Links     []LinkRecord   `json:"links"`
+	Backups   []BackupRecord `json:"backups,omitempty"`
+}
+
+// Manifest is the on-disk record of everything sym manages under a SymDir.
+// It is stored as <SymDir>/.sym/state.json.
+type Manifest struct {
+	Packages map[string]*PackageRecord `json:"packages"`
+}
+
+func manifestPath(symDir string) string {
+	return filepath.Join(symDir, manifestDirName, manifestFileName)
+}
+
+// loadManifest reads the manifest from SymDir, returning an empty manifest
+// if one does not exist yet.
+func loadManifest(symDir string) (*Manifest, error) {
+	path := manifestPath(symDir)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Manifest{Packages: make(map[string]*PackageRecord)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest %s: %w", path, err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	if m.Packages == nil {
+		m.Packages = make(map[string]*PackageRecord)
+	}
+	return &m, nil
+}
+
+// save writes the manifest to SymDir, replacing it atomically via a
+// write-then-rename so a crash mid-write can't corrupt existing state.
+func (m *Manifest) save(symDir string) error {
+	dir := filepath.Join(symDir, manifestDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory %s: %w", dir, err)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	path := manifestPath(symDir)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace manifest %s: %w", path, err)
+	}
+	return nil
+}
+
+// recordLink adds the manifest entry for a newly created link from
+// targetPath back to srcPath, creating the package record on first use.
+func (m *Manifest) recordLink(pkg, pkgPath, srcPath, targetPath string) {
+	rec, ok := m.Packages[pkg]
+	if !ok {
+		rec = &PackageRecord{Name: pkg}
+		m.Packages[pkg] = rec
+	}
+	if rec.Source == "" {
+		rec.Source = pkgPath
+		rec.Version = hashPackage(pkgPath)
+		rec.Installed = time.Now()
+	}
+
+	for _, link := range rec.Links {
+		if link.Target == targetPath {
+			return
+		}
+	}
+	rec.Links = append(rec.Links, LinkRecord{Target: targetPath, Source: srcPath})
+}
+
+// removeLink drops targetPath from the recorded links for pkg, removing the
+// package record entirely once it has no links and no backups left.
+func (m *Manifest) removeLink(pkg, targetPath string) {
+	rec, ok := m.Packages[pkg]
+	if !ok {
+		return
+	}
+
+	links := rec.Links[:0]
+	for _, link := range rec.Links {
+		if link.Target != targetPath {
+			links = append(links, link)
+		}
+	}
+	rec.Links = links
+
+	if len(rec.Links) == 0 && len(rec.Backups) == 0 {
+		delete(m.Packages, pkg)
+	}
+}
+
+// recordBackup adds a record of a backup taken for pkg under
+// ConflictBackup, creating the package record on first use.
+func (m *Manifest) recordBackup(pkg, target, backup string) {
+	rec, ok := m.Packages[pkg]
+	if !ok {
+		rec = &PackageRecord{Name: pkg}
+		m.Packages[pkg] = rec
+	}
+	rec.Backups = append(rec.Backups, BackupRecord{Target: target, Backup: backup})
+}
+
+// findFold looks up the package owning a folded directory link to
+// targetPath, if any.
+func (m *Manifest) findFold(targetPath string) (pkg string, rec *PackageRecord, link LinkRecord, ok bool) {
+	for name, r := range m.Packages {
+		for _, l := range r.Links {
+			if l.Dir && l.Target == targetPath {
+				return name, r, l, true
+			}
+		}
+	}
+	return "", nil, LinkRecord{}, false
+}
+
+// hashPackage derives a cheap fingerprint for a package directory so the
+// manifest can flag when a symed source tree has changed shape. It hashes
+// relative file paths and sizes rather than full contents to stay fast on
+// large packages.
+func hashPackage(pkgPath string) string {
+	h := sha256.New()
+	_ = filepath.Walk(pkgPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		rel, relErr := filepath.Rel(pkgPath, path)
+		if relErr != nil {
+			return nil
+		}
+		fmt.Fprintf(h, "%s:%d\n", rel, info.Size())
+		return nil
+	})
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,122 @@
+package sym
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const pkgConfigFileName = ".sym.yaml"
+
+// PkgConfig is the optional per-package declarative config read from
+// .sym.yaml at the root of a package directory.
+type PkgConfig struct {
+	// Ignore lists glob patterns, matched against the package-relative
+	// path and against its base name, to skip during the sym/unsym walk.
+	Ignore []string `yaml:"ignore"`
+	// Target overrides config.TargetDir for this package, e.g. "~/.config".
+	Target string `yaml:"target"`
+	// Links maps a package-relative source to a target path for files that
+	// should be placed outside the mirrored tree.
+	Links map[string]string `yaml:"links"`
+	Hooks PkgHooks          `yaml:"hooks"`
+}
+
+// PkgHooks are shell commands run around a package's sym/unsym operations,
+// executed from the package root.
+type PkgHooks struct {
+	PreSym    string `yaml:"pre_sym"`
+	PostSym   string `yaml:"post_sym"`
+	PreUnsym  string `yaml:"pre_unsym"`
+	PostUnsym string `yaml:"post_unsym"`
+}
+
+// loadPkgConfig reads the per-package config at pkgPath, returning a zero
+// value PkgConfig if none is present.
+func loadPkgConfig(pkgPath string) (*PkgConfig, error) {
+	path := filepath.Join(pkgPath, pkgConfigFileName)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &PkgConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var cfg PkgConfig
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// resolveTarget returns the target directory a package should be symed
+// into, applying the package's target: override (with ~ expanded) if set.
+func (c *PkgConfig) resolveTarget(defaultTarget string) (string, error) {
+	if c.Target == "" {
+		return defaultTarget, nil
+	}
+	return expandHome(c.Target)
+}
+
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve home directory: %w", err)
+	}
+	if path == "~" {
+		return home, nil
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~/")), nil
+}
+
+// ignored reports whether relPath (relative to the package root), or its
+// base name, matches any of the configured ignore globs, plus any extra
+// globs supplied on the CLI via --ignore.
+func (c *PkgConfig) ignored(relPath string, extra []string) (bool, error) {
+	patterns := append(append([]string{}, c.Ignore...), extra...)
+	for _, pattern := range patterns {
+		if matched, err := filepath.Match(pattern, relPath); err != nil {
+			return false, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		} else if matched {
+			return true, nil
+		}
+		if matched, err := filepath.Match(pattern, filepath.Base(relPath)); err != nil {
+			return false, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		} else if matched {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// runHook executes a configured hook command in pkgPath. It is a no-op for
+// an empty command, and prints rather than runs the command in Simulate
+// mode.
+func runHook(config *Config, pkgPath, command string) error {
+	if command == "" {
+		return nil
+	}
+	if config.Verbose || config.Simulate {
+		fmt.Printf("Running hook in %s: %s\n", pkgPath, command)
+	}
+	if config.Simulate {
+		return nil
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = pkgPath
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("hook failed (%s): %w", command, err)
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package sym
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// ListPackages writes every package currently tracked in the manifest to w,
+// one per line.
+func ListPackages(config *Config, w io.Writer) error {
+	release, err := withLock(config)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	manifest, err := loadManifest(config.SymDir)
+	if err != nil {
+		return err
+	}
+
+	if len(manifest.Packages) == 0 {
+		fmt.Fprintln(w, "no packages are currently symed")
+		return nil
+	}
+
+	for name, rec := range manifest.Packages {
+		fmt.Fprintf(w, "%s\t%d link(s)\tinstalled %s\n", name, len(rec.Links), rec.Installed.Format("2006-01-02 15:04:05"))
+	}
+	return nil
+}
+
+// StatusPackage reports the links sym manages for pkg, flagging any that are
+// broken (target missing) or drifted (target no longer points at the
+// recorded source), as well as whether the package's source tree has
+// changed since it was last symed.
+func StatusPackage(config *Config, pkg string, w io.Writer) error {
+	release, err := withLock(config)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	manifest, err := loadManifest(config.SymDir)
+	if err != nil {
+		return err
+	}
+
+	rec, ok := manifest.Packages[pkg]
+	if !ok {
+		fmt.Fprintf(w, "%s: not symed\n", pkg)
+		return nil
+	}
+
+	fmt.Fprintf(w, "%s: %d link(s), source %s\n", pkg, len(rec.Links), rec.Source)
+	if current := hashPackage(rec.Source); current != rec.Version {
+		fmt.Fprintf(w, "  drift   package contents changed since last sym (resym to refresh)\n")
+	}
+	for _, link := range rec.Links {
+		info, err := os.Lstat(link.Target)
+		switch {
+		case os.IsNotExist(err):
+			fmt.Fprintf(w, "  broken  %s (missing)\n", link.Target)
+		case err != nil:
+			fmt.Fprintf(w, "  error   %s (%v)\n", link.Target, err)
+		case info.Mode()&os.ModeSymlink == 0:
+			fmt.Fprintf(w, "  drift   %s (no longer a symlink)\n", link.Target)
+		default:
+			if current, err := os.Readlink(link.Target); err != nil || current != link.Source {
+				fmt.Fprintf(w, "  drift   %s -> %s (expected %s)\n", link.Target, current, link.Source)
+			} else {
+				fmt.Fprintf(w, "  ok      %s -> %s\n", link.Target, link.Source)
+			}
+		}
+	}
+	return nil
+}
+
+// Prune removes every managed symlink whose source file no longer exists
+// and updates the manifest to match.
+func Prune(config *Config) error {
+	release, err := withLock(config)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	manifest, err := loadManifest(config.SymDir)
+	if err != nil {
+		return err
+	}
+
+	for pkg, rec := range manifest.Packages {
+		var kept []LinkRecord
+		for _, link := range rec.Links {
+			if _, err := os.Stat(link.Source); os.IsNotExist(err) {
+				if config.Verbose {
+					fmt.Printf("Pruning broken link: %s -> %s\n", link.Target, link.Source)
+				}
+				if !config.Simulate {
+					if err := os.Remove(link.Target); err != nil && !os.IsNotExist(err) {
+						return fmt.Errorf("failed to prune %s: %w", link.Target, err)
+					}
+				}
+				continue
+			}
+			kept = append(kept, link)
+		}
+		rec.Links = kept
+		if len(rec.Links) == 0 && len(rec.Backups) == 0 {
+			delete(manifest.Packages, pkg)
+		}
+	}
+
+	if config.Simulate {
+		return nil
+	}
+	return manifest.save(config.SymDir)
+}
@@ -5,21 +5,58 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 const version = "1.0.0"
 
+// defaultLockTimeout is used when Config.LockTimeout is unset.
+const defaultLockTimeout = 30 * time.Second
+
+// Operation selects the action ProcessPackage performs for a package.
+type Operation int
+
+const (
+	// OperationSym creates the symlinks for a package.
+	OperationSym Operation = iota
+	// OperationUnsym removes the symlinks for a package.
+	OperationUnsym
+	// OperationResym unsyms a package and then syms it again.
+	OperationResym
+)
+
+// ConflictPolicy controls what createSymlink does when a target already
+// exists and isn't already the symlink it expected.
+type ConflictPolicy int
+
+const (
+	// ConflictFail aborts with an error. This is the default.
+	ConflictFail ConflictPolicy = iota
+	// ConflictAdopt moves the existing target into the package directory
+	// before symlinking, so an unmanaged dotfile becomes the source.
+	ConflictAdopt
+	// ConflictBackup renames the existing target aside before symlinking.
+	ConflictBackup
+	// ConflictOverwrite removes the existing target unconditionally.
+	ConflictOverwrite
+)
+
 type Config struct {
-	SymDir    string
-	TargetDir string
-	Verbose   bool
-	Simulate  bool
-	Delete    bool
-	ReSym     bool
-	Packages  []string
+	SymDir         string
+	TargetDir      string
+	Verbose        bool
+	Simulate       bool
+	NoFolding      bool
+	Conflict       ConflictPolicy
+	RestoreBackups bool
+	PruneDirs      bool
+	NoLock         bool
+	LockTimeout    time.Duration
+	ExtraIgnore    []string
+	Packages       []string
 }
 
-func ProcessPackage(config *Config, pkg string) error {
+func ProcessPackage(config *Config, pkg string, op Operation) error {
 	pkgPath := filepath.Join(config.SymDir, pkg)
 
 	// Check if package directory exists
@@ -27,24 +64,93 @@ func ProcessPackage(config *Config, pkg string) error {
 		return fmt.Errorf("package directory does not exist: %s", pkgPath)
 	}
 
-	if config.ReSym {
+	release, err := withLock(config)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	manifest, err := loadManifest(config.SymDir)
+	if err != nil {
+		return err
+	}
+
+	pkgConfig, err := loadPkgConfig(pkgPath)
+	if err != nil {
+		return err
+	}
+
+	targetDir, err := pkgConfig.resolveTarget(config.TargetDir)
+	if err != nil {
+		return err
+	}
+	pkgCfg := *config
+	pkgCfg.TargetDir = targetDir
+
+	switch op {
+	case OperationResym:
 		// Unstow first, then stow
-		if err := unsymPackage(config, pkg, pkgPath); err != nil {
+		if err := runHook(config, pkgPath, pkgConfig.Hooks.PreUnsym); err != nil {
+			return err
+		}
+		if err := unsymPackage(&pkgCfg, pkg, pkgPath, manifest, pkgConfig); err != nil {
 			return fmt.Errorf("failed to unsym during resym: %w", err)
 		}
-		return symPackage(config, pkg, pkgPath)
-	} else if config.Delete {
-		return unsymPackage(config, pkg, pkgPath)
-	} else {
-		return symPackage(config, pkg, pkgPath)
+		if err := runHook(config, pkgPath, pkgConfig.Hooks.PostUnsym); err != nil {
+			return err
+		}
+		if err := runHook(config, pkgPath, pkgConfig.Hooks.PreSym); err != nil {
+			return err
+		}
+		if err := symPackage(&pkgCfg, pkg, pkgPath, manifest, pkgConfig); err != nil {
+			return err
+		}
+		if err := runHook(config, pkgPath, pkgConfig.Hooks.PostSym); err != nil {
+			return err
+		}
+	case OperationUnsym:
+		if err := runHook(config, pkgPath, pkgConfig.Hooks.PreUnsym); err != nil {
+			return err
+		}
+		if err := unsymPackage(&pkgCfg, pkg, pkgPath, manifest, pkgConfig); err != nil {
+			return err
+		}
+		if err := runHook(config, pkgPath, pkgConfig.Hooks.PostUnsym); err != nil {
+			return err
+		}
+	default:
+		if err := runHook(config, pkgPath, pkgConfig.Hooks.PreSym); err != nil {
+			return err
+		}
+		if err := symPackage(&pkgCfg, pkg, pkgPath, manifest, pkgConfig); err != nil {
+			return err
+		}
+		if err := runHook(config, pkgPath, pkgConfig.Hooks.PostSym); err != nil {
+			return err
+		}
 	}
+
+	if config.Simulate {
+		return nil
+	}
+	return manifest.save(config.SymDir)
 }
 
-func symPackage(config *Config, pkg string, pkgPath string) error {
+func symPackage(config *Config, pkg string, pkgPath string, manifest *Manifest, pkgConfig *PkgConfig) error {
 	if config.Verbose {
 		fmt.Printf("Stowing package: %s\n", pkg)
 	}
 
+	for relSrc, dst := range pkgConfig.Links {
+		target, err := expandHome(dst)
+		if err != nil {
+			return err
+		}
+		if err := createSymlink(config, pkg, pkgPath, filepath.Join(pkgPath, relSrc), target, manifest); err != nil {
+			return err
+		}
+	}
+
 	return filepath.Walk(pkgPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -61,10 +167,44 @@ func symPackage(config *Config, pkg string, pkgPath string) error {
 			return err
 		}
 
+		if relPath == pkgConfigFileName {
+			return nil
+		}
+		if _, explicit := pkgConfig.Links[relPath]; explicit {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ignored, err := pkgConfig.ignored(relPath, config.ExtraIgnore); err != nil {
+			return err
+		} else if ignored {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
 		// Target path in the target directory
 		targetPath := filepath.Join(config.TargetDir, relPath)
 
 		if info.IsDir() {
+			if !config.NoFolding {
+				folded, err := foldDirectory(config, pkg, pkgPath, path, targetPath, manifest, pkgConfig)
+				if err != nil {
+					return err
+				}
+				if folded {
+					return filepath.SkipDir
+				}
+			}
+
+			// A previous package may have folded this directory into a
+			// single symlink; unfold it before adding our own entries.
+			if err := ensureUnfolded(config, targetPath, manifest); err != nil {
+				return err
+			}
+
 			// Create directory if it doesn't exist
 			if _, err := os.Stat(targetPath); os.IsNotExist(err) {
 				if config.Verbose {
@@ -78,7 +218,7 @@ func symPackage(config *Config, pkg string, pkgPath string) error {
 			}
 		} else {
 			// Create symlink for files
-			if err := createSymlink(config, path, targetPath); err != nil {
+			if err := createSymlink(config, pkg, pkgPath, path, targetPath, manifest); err != nil {
 				return err
 			}
 		}
@@ -87,57 +227,92 @@ func symPackage(config *Config, pkg string, pkgPath string) error {
 	})
 }
 
-func unsymPackage(config *Config, pkg string, pkgPath string) error {
+func unsymPackage(config *Config, pkg string, pkgPath string, manifest *Manifest, pkgConfig *PkgConfig) error {
 	if config.Verbose {
 		fmt.Printf("Unstowing package: %s\n", pkg)
 	}
 
-	return filepath.Walk(pkgPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-
-		// Skip the package root directory
-		if path == pkgPath {
-			return nil
-		}
+	rec, ok := manifest.Packages[pkg]
+	if !ok {
+		// No manifest record, e.g. the package was symed before the
+		// manifest existed: fall back to walking the source tree.
+		return filepath.Walk(pkgPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
 
-		// Get relative path within the package
-		relPath, err := filepath.Rel(pkgPath, path)
-		if err != nil {
-			return err
-		}
+			// Skip the package root directory
+			if path == pkgPath {
+				return nil
+			}
 
-		// Target path in the target directory
-		targetPath := filepath.Join(config.TargetDir, relPath)
+			// Get relative path within the package
+			relPath, err := filepath.Rel(pkgPath, path)
+			if err != nil {
+				return err
+			}
 
-		if !info.IsDir() {
-			// Remove symlink if it points to our file
-			if err := removeSymlink(config, path, targetPath); err != nil {
+			if relPath == pkgConfigFileName {
+				return nil
+			}
+			if ignored, err := pkgConfig.ignored(relPath, config.ExtraIgnore); err != nil {
 				return err
+			} else if ignored {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			targetPath := config.TargetDir
+			if dst, explicit := pkgConfig.Links[relPath]; explicit {
+				targetPath, err = expandHome(dst)
+				if err != nil {
+					return err
+				}
+			} else {
+				targetPath = filepath.Join(config.TargetDir, relPath)
+			}
+
+			if !info.IsDir() {
+				// Remove symlink if it points to our file
+				if err := removeSymlink(config, pkg, path, targetPath, manifest); err != nil {
+					return err
+				}
 			}
+
+			return nil
+		})
+	}
+
+	// Replay the recorded links instead of re-walking pkgPath, so unsym
+	// keeps working even after the source tree has changed underneath it.
+	for _, link := range append([]LinkRecord(nil), rec.Links...) {
+		if err := removeSymlink(config, pkg, link.Source, link.Target, manifest); err != nil {
+			return err
 		}
+	}
 
-		return nil
-	})
+	if config.RestoreBackups {
+		return restoreBackups(config, pkg, manifest)
+	}
+	return nil
 }
 
-func createSymlink(config *Config, srcPath, targetPath string) error {
+func createSymlink(config *Config, pkg, pkgPath, srcPath, targetPath string, manifest *Manifest) error {
 	// Check if target already exists
-	if _, err := os.Lstat(targetPath); err == nil {
+	if info, err := os.Lstat(targetPath); err == nil {
 		// Check if it's already the correct symlink
-		if link, err := os.Readlink(targetPath); err == nil {
-			if link == srcPath {
-				if config.Verbose {
-					fmt.Printf("Symlink already exists: %s -> %s\n", targetPath, srcPath)
-				}
-				return nil
-			} else {
-				return fmt.Errorf("target %s already exists and points to %s (not %s)",
-					targetPath, link, srcPath)
+		if link, err := os.Readlink(targetPath); err == nil && link == srcPath {
+			if config.Verbose {
+				fmt.Printf("Symlink already exists: %s -> %s\n", targetPath, srcPath)
 			}
-		} else {
-			return fmt.Errorf("target %s already exists and is not a symlink", targetPath)
+			manifest.recordLink(pkg, pkgPath, srcPath, targetPath)
+			return nil
+		}
+
+		if err := resolveConflict(config, pkg, srcPath, targetPath, info, manifest); err != nil {
+			return err
 		}
 	}
 
@@ -164,10 +339,11 @@ func createSymlink(config *Config, srcPath, targetPath string) error {
 		}
 	}
 
+	manifest.recordLink(pkg, pkgPath, srcPath, targetPath)
 	return nil
 }
 
-func removeSymlink(config *Config, srcPath, targetPath string) error {
+func removeSymlink(config *Config, pkg, srcPath, targetPath string, manifest *Manifest) error {
 	// Check if target exists and is a symlink
 	info, err := os.Lstat(targetPath)
 	if os.IsNotExist(err) {
@@ -211,5 +387,11 @@ func removeSymlink(config *Config, srcPath, targetPath string) error {
 		}
 	}
 
+	manifest.removeLink(pkg, targetPath)
+
+	if config.PruneDirs {
+		pruneEmptyDirs(config, filepath.Dir(targetPath))
+	}
+
 	return nil
 }
@@ -0,0 +1,253 @@
+package sym
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestConfig(t *testing.T) *Config {
+	t.Helper()
+	symDir := t.TempDir()
+	targetDir := t.TempDir()
+	return &Config{
+		SymDir:    symDir,
+		TargetDir: targetDir,
+		NoLock:    true,
+	}
+}
+
+func mustWriteFile(t *testing.T, path string, data []byte, mode os.FileMode) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, data, mode); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+}
+
+// TestUnsymReplayAfterSourceChange verifies that unsym removes a package's
+// symlinks by replaying the manifest's recorded links rather than
+// re-walking the source tree, so removal keeps working even after a file is
+// renamed out from under it.
+func TestUnsymReplayAfterSourceChange(t *testing.T) {
+	config := newTestConfig(t)
+	pkgPath := filepath.Join(config.SymDir, "vim")
+	mustWriteFile(t, filepath.Join(pkgPath, "vimrc"), []byte("set nocompatible\n"), 0644)
+
+	if err := ProcessPackage(config, "vim", OperationSym); err != nil {
+		t.Fatalf("sym failed: %v", err)
+	}
+
+	targetPath := filepath.Join(config.TargetDir, "vimrc")
+	if _, err := os.Lstat(targetPath); err != nil {
+		t.Fatalf("expected symlink at %s: %v", targetPath, err)
+	}
+
+	if err := os.Rename(filepath.Join(pkgPath, "vimrc"), filepath.Join(pkgPath, "vimrc.renamed")); err != nil {
+		t.Fatalf("failed to rename source file: %v", err)
+	}
+
+	if err := ProcessPackage(config, "vim", OperationUnsym); err != nil {
+		t.Fatalf("unsym failed: %v", err)
+	}
+
+	if _, err := os.Lstat(targetPath); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got err=%v", targetPath, err)
+	}
+}
+
+// TestFoldUnfoldRoundTrip verifies that a second package adding files under
+// a directory the first package folded into a single symlink triggers
+// ensureUnfolded, after which both packages' files are individually linked
+// under a real directory.
+func TestFoldUnfoldRoundTrip(t *testing.T) {
+	config := newTestConfig(t)
+
+	pkgAPath := filepath.Join(config.SymDir, "pkga")
+	mustWriteFile(t, filepath.Join(pkgAPath, "bin", "foo"), []byte("foo\n"), 0755)
+
+	if err := ProcessPackage(config, "pkga", OperationSym); err != nil {
+		t.Fatalf("sym pkga failed: %v", err)
+	}
+
+	binPath := filepath.Join(config.TargetDir, "bin")
+	info, err := os.Lstat(binPath)
+	if err != nil {
+		t.Fatalf("expected folded bin symlink: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected %s to be folded into a directory symlink", binPath)
+	}
+
+	pkgBPath := filepath.Join(config.SymDir, "pkgb")
+	mustWriteFile(t, filepath.Join(pkgBPath, "bin", "bar"), []byte("bar\n"), 0755)
+
+	if err := ProcessPackage(config, "pkgb", OperationSym); err != nil {
+		t.Fatalf("sym pkgb failed: %v", err)
+	}
+
+	info, err = os.Lstat(binPath)
+	if err != nil {
+		t.Fatalf("expected bin directory after unfold: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Fatalf("expected %s to be a real directory after unfold, still a symlink", binPath)
+	}
+
+	for _, name := range []string{"foo", "bar"} {
+		link := filepath.Join(binPath, name)
+		if _, err := os.Lstat(link); err != nil {
+			t.Fatalf("expected %s to exist after unfold: %v", link, err)
+		}
+	}
+}
+
+// TestFoldIsIdempotent verifies that syming an already-folded package a
+// second time leaves the folded directory symlink alone instead of
+// unfolding it back into per-file symlinks.
+func TestFoldIsIdempotent(t *testing.T) {
+	config := newTestConfig(t)
+
+	pkgPath := filepath.Join(config.SymDir, "pkga")
+	mustWriteFile(t, filepath.Join(pkgPath, "bin", "foo"), []byte("foo\n"), 0755)
+
+	if err := ProcessPackage(config, "pkga", OperationSym); err != nil {
+		t.Fatalf("first sym failed: %v", err)
+	}
+
+	binPath := filepath.Join(config.TargetDir, "bin")
+	info, err := os.Lstat(binPath)
+	if err != nil {
+		t.Fatalf("expected folded bin symlink: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("expected %s to be folded into a directory symlink", binPath)
+	}
+
+	if err := ProcessPackage(config, "pkga", OperationSym); err != nil {
+		t.Fatalf("second sym failed: %v", err)
+	}
+
+	info, err = os.Lstat(binPath)
+	if err != nil {
+		t.Fatalf("expected %s to still exist after re-sym: %v", binPath, err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Fatalf("re-syming an already-folded package unfolded %s into a real directory", binPath)
+	}
+}
+
+// TestFoldExcludesLinksMappedFile verifies that a subtree containing an
+// explicit pkgConfig.Links remap is never folded, since folding would
+// mirror that file inside the folded directory in addition to its remapped
+// target.
+func TestFoldExcludesLinksMappedFile(t *testing.T) {
+	config := newTestConfig(t)
+
+	pkgPath := filepath.Join(config.SymDir, "app")
+	mustWriteFile(t, filepath.Join(pkgPath, "conf", "normal"), []byte("normal\n"), 0644)
+	mustWriteFile(t, filepath.Join(pkgPath, "conf", "special"), []byte("special\n"), 0644)
+
+	remapTarget := filepath.Join(config.TargetDir, "elsewhere", "special")
+	mustWriteFile(t, filepath.Join(pkgPath, pkgConfigFileName),
+		[]byte("links:\n  conf/special: "+remapTarget+"\n"), 0644)
+
+	if err := ProcessPackage(config, "app", OperationSym); err != nil {
+		t.Fatalf("sym failed: %v", err)
+	}
+
+	confPath := filepath.Join(config.TargetDir, "conf")
+	info, err := os.Lstat(confPath)
+	if err != nil {
+		t.Fatalf("expected %s to exist: %v", confPath, err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Fatalf("expected %s to not be folded since it contains a Links remap", confPath)
+	}
+
+	if _, err := os.Lstat(filepath.Join(confPath, "special")); !os.IsNotExist(err) {
+		t.Fatalf("expected %s/special to not be mirrored, got err=%v", confPath, err)
+	}
+
+	if _, err := os.Lstat(remapTarget); err != nil {
+		t.Fatalf("expected remapped target %s to exist: %v", remapTarget, err)
+	}
+}
+
+// TestAdoptPreservesContentAndMode verifies that adopting a conflicting
+// target into the package keeps both its content and file mode intact.
+func TestAdoptPreservesContentAndMode(t *testing.T) {
+	config := newTestConfig(t)
+	config.Conflict = ConflictAdopt
+
+	pkgPath := filepath.Join(config.SymDir, "app")
+	mustWriteFile(t, filepath.Join(pkgPath, "config.ini"), []byte("placeholder\n"), 0644)
+
+	targetPath := filepath.Join(config.TargetDir, "config.ini")
+	content := []byte("secret=1\n")
+	mustWriteFile(t, targetPath, content, 0600)
+
+	if err := ProcessPackage(config, "app", OperationSym); err != nil {
+		t.Fatalf("sym failed: %v", err)
+	}
+
+	srcPath := filepath.Join(pkgPath, "config.ini")
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		t.Fatalf("expected adopted file at %s: %v", srcPath, err)
+	}
+	if string(data) != string(content) {
+		t.Fatalf("adopted file content = %q, want %q", data, content)
+	}
+
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		t.Fatalf("failed to stat adopted file: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("adopted file mode = %s, want %s", info.Mode().Perm(), os.FileMode(0600))
+	}
+
+	link, err := os.Readlink(targetPath)
+	if err != nil {
+		t.Fatalf("expected %s to become a symlink: %v", targetPath, err)
+	}
+	if link != srcPath {
+		t.Fatalf("target symlink = %s, want %s", link, srcPath)
+	}
+}
+
+// TestStatusReportsSourceDrift verifies that sym status flags a package
+// whose source tree has changed since it was last symed, using the
+// manifest's stored hash of the package's file paths and sizes.
+func TestStatusReportsSourceDrift(t *testing.T) {
+	config := newTestConfig(t)
+	pkgPath := filepath.Join(config.SymDir, "vim")
+	mustWriteFile(t, filepath.Join(pkgPath, "vimrc"), []byte("set nocompatible\n"), 0644)
+
+	if err := ProcessPackage(config, "vim", OperationSym); err != nil {
+		t.Fatalf("sym failed: %v", err)
+	}
+
+	var before bytes.Buffer
+	if err := StatusPackage(config, "vim", &before); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if strings.Contains(before.String(), "drift") {
+		t.Fatalf("expected no drift right after sym, got:\n%s", before.String())
+	}
+
+	mustWriteFile(t, filepath.Join(pkgPath, "gvimrc"), []byte("set guifont=mono\n"), 0644)
+
+	var after bytes.Buffer
+	if err := StatusPackage(config, "vim", &after); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if !strings.Contains(after.String(), "drift") {
+		t.Fatalf("expected drift after adding a file to the source tree, got:\n%s", after.String())
+	}
+}